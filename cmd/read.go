@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"github.com/k1LoW/tcpdp/dumper"
+	"github.com/k1LoW/tcpdp/dumper/amqp"
+	"github.com/k1LoW/tcpdp/dumper/http"
+	"github.com/k1LoW/tcpdp/dumper/mongodb"
+	"github.com/k1LoW/tcpdp/dumper/redis"
+	"github.com/k1LoW/tcpdp/metrics"
+	"github.com/k1LoW/tcpdp/reader"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	readTarget      string
+	readProtocol    string
+	readSpeed       float64
+	readMetricsAddr string
+)
+
+// readCmd implements `tcpdp read FILE...`, reprocessing one or more
+// archived pcap/pcapng captures through the reassembly + dumper pipeline
+// so protocol dumpers can be applied retroactively.
+var readCmd = &cobra.Command{
+	Use:   "read [flags] FILE...",
+	Short: "Replay pcap/pcapng captures through a protocol dumper",
+	Long:  "read reprocesses one or more captures (pcap/pcapng, shell globs allowed) through the configured --target and --protocol dumper, the same way a live `tcpdp probe` capture would.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runRead,
+}
+
+func init() {
+	readCmd.Flags().StringVar(&readTarget, "target", "", "probe target (host:port) to match, same format as `tcpdp probe --target`")
+	readCmd.Flags().StringVar(&readProtocol, "protocol", "", "protocol dumper to use (http, redis, mongodb, amqp)")
+	readCmd.Flags().Float64Var(&readSpeed, "speed", 0, "pace output by capture timestamps at this multiplier (0 = as fast as possible)")
+	readCmd.Flags().StringVar(&readMetricsAddr, "metrics-addr", "", "expose Prometheus metrics on this address (e.g. :9090), same as probe.metrics_addr")
+	RootCmd.AddCommand(readCmd)
+}
+
+func runRead(cmd *cobra.Command, args []string) error {
+	files, err := expandReadGlobs(args)
+	if err != nil {
+		return err
+	}
+
+	host, port, err := reader.ParseTarget(readTarget)
+	if err != nil {
+		return err
+	}
+	filter := reader.NewBPFFilterString(host, port)
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	defer logger.Sync()
+
+	d, err := newReadDumper(readProtocol, logger)
+	if err != nil {
+		return err
+	}
+
+	shutdownMetrics := metrics.Serve(readMetricsAddr, logger)
+	defer shutdownMetrics(context.Background())
+
+	for _, file := range files {
+		if err := replayFile(file, filter, host, port, d, logger); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func replayFile(file, filter string, host string, port uint16, d dumper.Dumper, logger *zap.Logger) error {
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	if filter != "" {
+		if err := handle.SetBPFFilter(filter); err != nil {
+			return err
+		}
+	}
+
+	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := reader.NewPacketReader(ctx, cancel, packetSource, d, nil, logger, 1000)
+	return r.ReadOffline(host, port, readSpeed)
+}
+
+// expandReadGlobs resolves shell globs in args, falling back to the
+// literal argument when it matches nothing (so a single, non-glob path
+// still works).
+func expandReadGlobs(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			files = append(files, arg)
+			continue
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+func newReadDumper(protocol string, logger *zap.Logger) (dumper.Dumper, error) {
+	switch protocol {
+	case "http":
+		return http.NewDumper(logger), nil
+	case "redis":
+		return redis.NewDumper(logger), nil
+	case "mongodb":
+		return mongodb.NewDumper(logger), nil
+	case "amqp":
+		return amqp.NewDumper(logger), nil
+	default:
+		return nil, fmt.Errorf("read: unsupported --protocol %q", protocol)
+	}
+}
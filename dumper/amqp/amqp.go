@@ -0,0 +1,266 @@
+// Package amqp implements dumper.Dumper for AMQP 0-9-1, decoding the frame
+// header and a handful of method frames (connection.start, connection.open,
+// basic.publish, basic.deliver) into vhost/routing-key/exchange/method dump
+// values.
+package amqp
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+)
+
+const (
+	frameMethod = 1
+
+	classConnection = 10
+	methodStart     = 10
+	methodOpen      = 40
+
+	classBasic    = 60
+	methodPublish = 40
+	methodDeliver = 60
+
+	// maxFrameSize bounds a sane AMQP frame payload size; the protocol
+	// itself allows up to 2^32-1, but real brokers/clients negotiate a
+	// much smaller frame_max (commonly 128KB), so a frame claiming
+	// anything past this is corrupted framing, not just one we haven't
+	// finished buffering yet.
+	maxFrameSize = 16 * 1024 * 1024
+)
+
+// Dumper is a dumper.Dumper for AMQP 0-9-1.
+type Dumper struct {
+	logger *zap.Logger
+	conns  *dumper.ConnStore[connState]
+}
+
+// connState holds the buffered, not-yet-complete frame bytes for a single
+// connection, and tracks whether its connection.open vhost and its
+// leading protocol header have already been seen.
+type connState struct {
+	buf       []byte
+	sawVhost  bool
+	sawHeader bool
+}
+
+// NewDumper returns a new Dumper.
+func NewDumper(logger *zap.Logger) *Dumper {
+	return &Dumper{
+		logger: logger,
+		conns:  dumper.NewConnStore[connState](),
+	}
+}
+
+// NewConnMetadata implements dumper.Dumper.
+func (d *Dumper) NewConnMetadata() *dumper.ConnMetadata {
+	return &dumper.ConnMetadata{
+		DumpValues: []dumper.DumpValue{},
+	}
+}
+
+// Read implements dumper.Dumper. ReassembledSG hands over arbitrary
+// contiguous byte runs, not frame-aligned ones, so cs.buf accumulates them
+// and nextFrame consumes exactly one frame (or the leading protocol
+// header) at a time; a run holding several frames, which AMQP packs
+// routinely, is parsed in a loop rather than just the first.
+func (d *Dumper) Read(in []byte, direction dumper.Direction, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	cs := d.conns.Get(connMetadata)
+	cs.buf = append(cs.buf, in...)
+
+	var pending []dumper.DumpValue
+	for {
+		frameType, payload, ok, err := nextFrame(cs)
+		if err != nil {
+			// the buffer is desynced with no way to resume framing -
+			// drop it rather than re-erroring on the same bytes forever
+			cs.buf = nil
+			return pending, err
+		}
+		if !ok {
+			break
+		}
+
+		var values []dumper.DumpValue
+		if frameType == frameMethod {
+			values = d.readMethodFrame(payload, connMetadata)
+		}
+		if len(values) == 0 {
+			// protocol header, or a header/body/heartbeat frame (only
+			// method frames are summarized) -- nothing to dump
+			continue
+		}
+		if pending != nil {
+			dumper.LogPending(d, pending, connMetadata)
+		}
+		pending = values
+	}
+	return pending, nil
+}
+
+// nextFrame consumes one unit from the front of cs.buf: either the 8-byte
+// "AMQP" protocol header (sent once, at connection start, with no frame
+// type byte of its own) or a type+channel+size-framed AMQP frame,
+// including its trailing frame-end octet. ok is false when buf doesn't yet
+// hold a complete unit; err is non-nil when the frame header is fully
+// buffered but its declared size is implausibly large, which (unlike an
+// incomplete frame) will never become parseable by waiting for more bytes.
+//
+// The protocol header is only ever checked for before cs.sawHeader is set:
+// once the real header (or, failing that, the first real frame) has been
+// consumed, a later frame payload that merely happens to start with the
+// bytes "AMQP" -- e.g. inside a basic.publish body -- must not be
+// misidentified as a second header, which would desync all frame parsing
+// for the rest of the connection.
+func nextFrame(cs *connState) (frameType byte, payload []byte, ok bool, err error) {
+	b := cs.buf
+	if !cs.sawHeader && len(b) >= 8 && string(b[0:4]) == "AMQP" {
+		cs.sawHeader = true
+		cs.buf = b[8:]
+		return 0, nil, true, nil
+	}
+	if len(b) < 8 {
+		return 0, nil, false, nil
+	}
+
+	payloadSize := binary.BigEndian.Uint32(b[3:7])
+	if payloadSize > maxFrameSize {
+		return 0, nil, false, fmt.Errorf("amqp: implausible frame size %d", payloadSize)
+	}
+	frameEnd := 7 + uint64(payloadSize)
+	if frameEnd+1 > uint64(len(b)) {
+		return 0, nil, false, nil
+	}
+
+	cs.sawHeader = true
+	frameType = b[0]
+	payload = b[7:frameEnd]
+	cs.buf = b[frameEnd+1:]
+	return frameType, payload, true, nil
+}
+
+func (d *Dumper) readMethodFrame(payload []byte, connMetadata *dumper.ConnMetadata) []dumper.DumpValue {
+	if len(payload) < 4 {
+		return nil
+	}
+
+	classID := binary.BigEndian.Uint16(payload[0:2])
+	methodID := binary.BigEndian.Uint16(payload[2:4])
+	args := payload[4:]
+
+	switch {
+	case classID == classConnection && methodID == methodStart:
+		return readConnectionStart()
+	case classID == classConnection && methodID == methodOpen:
+		return d.readConnectionOpen(args, connMetadata)
+	case classID == classBasic && methodID == methodPublish:
+		return readBasicPublish(args)
+	case classID == classBasic && methodID == methodDeliver:
+		return readBasicDeliver(args)
+	default:
+		return []dumper.DumpValue{
+			{Key: "amqp_class_id", Value: classID},
+			{Key: "amqp_method_id", Value: methodID},
+		}
+	}
+}
+
+// readConnectionStart reports the handshake method only: connection.start
+// doesn't carry a vhost (that's negotiated later, in connection.open).
+func readConnectionStart() []dumper.DumpValue {
+	return []dumper.DumpValue{
+		{Key: "amqp_method", Value: "connection.start"},
+	}
+}
+
+// readConnectionOpen decodes connection.open, whose first argument is the
+// vhost shortstr the client is opening the connection against.
+func (d *Dumper) readConnectionOpen(args []byte, connMetadata *dumper.ConnMetadata) []dumper.DumpValue {
+	vhost, _, ok := readShortStr(args, 0)
+	if !ok {
+		return []dumper.DumpValue{
+			{Key: "amqp_method", Value: "connection.open"},
+		}
+	}
+
+	cs := d.conns.Get(connMetadata)
+	if !cs.sawVhost {
+		cs.sawVhost = true
+		connMetadata.DumpValues = append(connMetadata.DumpValues, dumper.DumpValue{
+			Key:   "amqp_vhost",
+			Value: vhost,
+		})
+	}
+	return []dumper.DumpValue{
+		{Key: "amqp_method", Value: "connection.open"},
+		{Key: "amqp_vhost", Value: vhost},
+	}
+}
+
+func readBasicPublish(args []byte) []dumper.DumpValue {
+	pos := 2 // reserved-1 (short)
+	exchange, n, ok := readShortStr(args, pos)
+	if !ok {
+		return nil
+	}
+	pos += n
+	routingKey, _, ok := readShortStr(args, pos)
+	if !ok {
+		return nil
+	}
+	return []dumper.DumpValue{
+		{Key: "amqp_method", Value: "basic.publish"},
+		{Key: "amqp_exchange", Value: exchange},
+		{Key: "amqp_routing_key", Value: routingKey},
+	}
+}
+
+func readBasicDeliver(args []byte) []dumper.DumpValue {
+	_, n, ok := readShortStr(args, 0) // consumer-tag
+	if !ok {
+		return nil
+	}
+	pos := n + 8 + 1 // delivery-tag (longlong) + redelivered (bit/octet)
+	exchange, n2, ok := readShortStr(args, pos)
+	if !ok {
+		return nil
+	}
+	pos += n2
+	routingKey, _, ok := readShortStr(args, pos)
+	if !ok {
+		return nil
+	}
+	return []dumper.DumpValue{
+		{Key: "amqp_method", Value: "basic.deliver"},
+		{Key: "amqp_exchange", Value: exchange},
+		{Key: "amqp_routing_key", Value: routingKey},
+	}
+}
+
+// readShortStr reads an AMQP shortstr (1-byte length prefix) at offset,
+// returning its value and the number of bytes it occupied.
+func readShortStr(b []byte, offset int) (string, int, bool) {
+	if offset < 0 || offset >= len(b) {
+		return "", 0, false
+	}
+	l := int(b[offset])
+	start := offset + 1
+	end := start + l
+	if end > len(b) {
+		return "", 0, false
+	}
+	return string(b[start:end]), 1 + l, true
+}
+
+// Log implements dumper.Dumper.
+func (d *Dumper) Log(values []dumper.DumpValue) {
+	dumper.LogFields(d.logger, values)
+}
+
+// CloseConn implements the optional connCloser interface reader uses to
+// release per-connection state once a flow's reassembly is complete.
+func (d *Dumper) CloseConn(connMetadata *dumper.ConnMetadata) {
+	d.conns.CloseConn(connMetadata)
+}
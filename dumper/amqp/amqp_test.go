@@ -0,0 +1,204 @@
+package amqp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// shortStr builds an AMQP shortstr: a 1-byte length prefix followed by s.
+func shortStr(s string) []byte {
+	return append([]byte{byte(len(s))}, []byte(s)...)
+}
+
+// frame wraps payload in a type+channel+size-framed AMQP frame, including
+// its trailing frame-end octet.
+func frame(frameType byte, payload []byte) []byte {
+	f := make([]byte, 7, 7+len(payload)+1)
+	f[0] = frameType
+	binary.BigEndian.PutUint16(f[1:3], 0) // channel
+	binary.BigEndian.PutUint32(f[3:7], uint32(len(payload)))
+	f = append(f, payload...)
+	f = append(f, 0xCE) // frame-end
+	return f
+}
+
+func methodFrame(classID, methodID uint16, args []byte) []byte {
+	payload := make([]byte, 4, 4+len(args))
+	binary.BigEndian.PutUint16(payload[0:2], classID)
+	binary.BigEndian.PutUint16(payload[2:4], methodID)
+	payload = append(payload, args...)
+	return frame(frameMethod, payload)
+}
+
+func connectionOpenFrame(vhost string) []byte {
+	return methodFrame(classConnection, methodOpen, shortStr(vhost))
+}
+
+func assertDumpValue(t *testing.T, values []dumper.DumpValue, key string, want interface{}) {
+	t.Helper()
+	for _, v := range values {
+		if v.Key == key {
+			if v.Value != want {
+				t.Errorf("%s = %v, want %v", key, v.Value, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no %q DumpValue in %v", key, values)
+}
+
+func TestNextFrame(t *testing.T) {
+	full := connectionOpenFrame("/myvhost")
+
+	cs := &connState{buf: append([]byte{}, full...)}
+	frameType, payload, ok, err := nextFrame(cs)
+	if err != nil {
+		t.Fatalf("nextFrame() err = %v, want nil", err)
+	}
+	if !ok {
+		t.Fatalf("nextFrame() ok = false, want true")
+	}
+	if frameType != frameMethod {
+		t.Errorf("frameType = %d, want %d", frameType, frameMethod)
+	}
+	if len(payload) != len(full)-8 {
+		t.Errorf("len(payload) = %d, want %d", len(payload), len(full)-8)
+	}
+	if len(cs.buf) != 0 {
+		t.Errorf("len(remaining buf) = %d, want 0", len(cs.buf))
+	}
+
+	truncatedCS := &connState{buf: full[:len(full)-1]}
+	if _, _, ok, err := nextFrame(truncatedCS); ok || err != nil {
+		t.Errorf("nextFrame() on a truncated frame = (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+
+	protoHeader := []byte("AMQP\x00\x00\x09\x01")
+	headerCS := &connState{buf: append(append([]byte{}, protoHeader...), full...)}
+	frameType, _, ok, err = nextFrame(headerCS)
+	if err != nil || !ok || frameType != 0 {
+		t.Fatalf("nextFrame() on the protocol header = (%d, ok=%v, err=%v), want (0, true, nil)", frameType, ok, err)
+	}
+	if len(headerCS.buf) != len(full) {
+		t.Errorf("len(remaining buf) after the protocol header = %d, want %d", len(headerCS.buf), len(full))
+	}
+	if !headerCS.sawHeader {
+		t.Errorf("sawHeader = false after consuming the protocol header, want true")
+	}
+
+	oversizedCS := &connState{buf: frame(frameMethod, make([]byte, 0))}
+	binary.BigEndian.PutUint32(oversizedCS.buf[3:7], maxFrameSize+1)
+	if _, _, ok, err := nextFrame(oversizedCS); ok || err == nil {
+		t.Errorf("nextFrame() on an oversized frame size = (ok=%v, err=%v), want (false, non-nil)", ok, err)
+	}
+}
+
+func TestDumperReadSplitAcrossCalls(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	full := connectionOpenFrame("/myvhost")
+	head, tail := full[:5], full[5:]
+
+	if got, err := d.Read(head, dumper.SrcToDst, cm); got != nil || err != nil {
+		t.Fatalf("Read() with a partial frame = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := d.Read(tail, dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() after completing the frame err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() after completing the frame = nil, want dump values")
+	}
+	assertDumpValue(t, got, "amqp_method", "connection.open")
+	assertDumpValue(t, got, "amqp_vhost", "/myvhost")
+}
+
+func TestDumperReadPipelinedFrames(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	d := NewDumper(zap.New(core))
+	cm := d.NewConnMetadata()
+
+	start := methodFrame(classConnection, methodStart, nil)
+	open := connectionOpenFrame("/myvhost")
+
+	got, err := d.Read(append(append([]byte{}, start...), open...), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() = nil, want the second pipelined frame's dump values")
+	}
+	assertDumpValue(t, got, "amqp_method", "connection.open")
+	if logs.Len() != 1 {
+		t.Fatalf("logged %d records for the leading pipelined frame, want 1", logs.Len())
+	}
+}
+
+func TestNextFrameIgnoresAMQPPrefixAfterHeader(t *testing.T) {
+	// A frame payload that happens to start with the literal bytes "AMQP"
+	// must not be misidentified as a second protocol header once the
+	// connection is past its initial handshake.
+	cs := &connState{sawHeader: true}
+	cs.buf = methodFrame(classBasic, methodPublish, []byte("AMQPxxxx"))
+
+	frameType, payload, ok, err := nextFrame(cs)
+	if err != nil {
+		t.Fatalf("nextFrame() err = %v, want nil", err)
+	}
+	if !ok {
+		t.Fatalf("nextFrame() ok = false, want true")
+	}
+	if frameType != frameMethod {
+		t.Errorf("frameType = %d, want %d (the frame should parse as a method frame, not be skipped as a protocol header)", frameType, frameMethod)
+	}
+	if len(payload) == 0 {
+		t.Errorf("payload is empty, want the method frame's class/method/args")
+	}
+	if len(cs.buf) != 0 {
+		t.Errorf("len(remaining buf) = %d, want 0", len(cs.buf))
+	}
+}
+
+func TestDumperReadVhostRecordedOnce(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	open := connectionOpenFrame("/myvhost")
+	if _, err := d.Read(open, dumper.SrcToDst, cm); err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if _, err := d.Read(open, dumper.SrcToDst, cm); err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+
+	count := 0
+	for _, v := range cm.DumpValues {
+		if v.Key == "amqp_vhost" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("amqp_vhost recorded %d times, want 1", count)
+	}
+}
+
+func TestDumperReadOversizedFrameReturnsError(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	buf := frame(frameMethod, make([]byte, 0))
+	binary.BigEndian.PutUint32(buf[3:7], maxFrameSize+1)
+
+	got, err := d.Read(buf, dumper.SrcToDst, cm)
+	if err == nil {
+		t.Fatalf("Read() err = nil, want a parse error for an implausible frame size")
+	}
+	if got != nil {
+		t.Errorf("Read() values = %v, want nil alongside the error", got)
+	}
+}
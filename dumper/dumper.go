@@ -0,0 +1,128 @@
+// Package dumper defines the Dumper interface that protocol-specific
+// packages (http, redis, mongodb, amqp) implement, along with the types
+// and per-connection state helpers they share.
+package dumper
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Direction indicates which logical side of a connection a byte run came
+// from, relative to the configured probe target.
+type Direction int
+
+// Direction values. Unknown means the flow couldn't be matched to either
+// side of the configured target (e.g. no --target was given).
+const (
+	Unknown Direction = iota
+	SrcToDst
+	DstToSrc
+)
+
+// DumpValue is a single key/value pair attached to a dump record.
+type DumpValue struct {
+	Key   string
+	Value interface{}
+}
+
+// ConnMetadata is created once per connection and carries the DumpValues
+// -- conn_id, mss, local_pid, and anything a Dumper records as stable for
+// the life of the connection (e.g. an authenticated db) -- that get
+// attached to every dump logged for it.
+type ConnMetadata struct {
+	DumpValues []DumpValue
+}
+
+// Dumper decodes a protocol's reassembled byte stream into loggable
+// DumpValues.
+type Dumper interface {
+	// NewConnMetadata returns the ConnMetadata to track for a new connection.
+	NewConnMetadata() *ConnMetadata
+	// Read decodes in, the bytes reassembled for one direction of a flow,
+	// returning the DumpValues for the message(s) it consumed. It may also
+	// append to connMetadata.DumpValues when it discovers a value -- such
+	// as an authenticated db or HTTP host -- that should be attached to
+	// every future dump on this connection. A non-nil error reports input
+	// that is fully buffered but malformed (as opposed to simply
+	// incomplete, which Read instead waits out silently); values may still
+	// be non-empty alongside an error when some pipelined messages parsed
+	// before the bad one was hit.
+	Read(in []byte, direction Direction, connMetadata *ConnMetadata) ([]DumpValue, error)
+	// Log writes a fully assembled dump record.
+	Log(values []DumpValue)
+}
+
+// ConnID returns the conn_id DumpValue reader attaches to every
+// ConnMetadata, or "" if unset.
+func ConnID(cm *ConnMetadata) string {
+	for _, v := range cm.DumpValues {
+		if v.Key == "conn_id" {
+			if s, ok := v.Value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// LogFields writes values to logger as a single "dump" record. It's the
+// Log implementation shared by every protocol dumper.
+func LogFields(logger *zap.Logger, values []DumpValue) {
+	fields := make([]zap.Field, 0, len(values))
+	for _, v := range values {
+		fields = append(fields, zap.Any(v.Key, v.Value))
+	}
+	logger.Info("dump", fields...)
+}
+
+// LogPending writes values immediately via d.Log, merged with
+// connMetadata's connection-level DumpValues (e.g. conn_id). Dumpers that
+// buffer more than one complete frame per Read call use this to emit every
+// frame but the last as soon as it's parsed; the last is returned normally
+// instead, so reader can attach ts/src_addr/dst_addr to it before logging.
+func LogPending(d Dumper, values []DumpValue, connMetadata *ConnMetadata) {
+	if len(values) == 0 {
+		return
+	}
+	d.Log(append(append([]DumpValue{}, values...), connMetadata.DumpValues...))
+}
+
+// ConnStore is a mutex-guarded, conn_id-keyed map of per-connection parser
+// state of type T. It's shared by every protocol dumper so each one
+// doesn't hand-roll its own map+mutex+CloseConn.
+type ConnStore[T any] struct {
+	mu    sync.Mutex
+	conns map[string]*T
+}
+
+// NewConnStore returns an empty ConnStore.
+func NewConnStore[T any]() *ConnStore[T] {
+	return &ConnStore[T]{conns: map[string]*T{}}
+}
+
+// Get returns the state for connMetadata's connection, creating a zero
+// value T the first time this connection is seen.
+func (s *ConnStore[T]) Get(connMetadata *ConnMetadata) *T {
+	id := ConnID(connMetadata)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs, ok := s.conns[id]
+	if !ok {
+		cs = new(T)
+		s.conns[id] = cs
+	}
+	return cs
+}
+
+// CloseConn releases the state for connMetadata's connection. Dumpers
+// embedding a ConnStore expose this as their own CloseConn, called by
+// reader once a flow's reassembly is complete, so conns doesn't grow
+// unbounded over a long-running capture.
+func (s *ConnStore[T]) CloseConn(connMetadata *ConnMetadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, ConnID(connMetadata))
+}
@@ -0,0 +1,208 @@
+// Package http implements dumper.Dumper for HTTP/1.0 and HTTP/1.1 traffic,
+// parsing request lines, headers, status codes and response sizes off the
+// reassembled byte stream (including pipelined requests/responses).
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+)
+
+// Dumper is a dumper.Dumper for HTTP/1.x.
+type Dumper struct {
+	logger *zap.Logger
+	conns  *dumper.ConnStore[connState]
+}
+
+// connState holds the per-connection buffers needed to parse pipelined
+// HTTP/1.x requests and responses.
+type connState struct {
+	reqBuf []byte
+	resBuf []byte
+	host   string
+
+	// pendingMethods is the queue of request methods awaiting their
+	// matching response, oldest first, so readResponse knows (for
+	// example) that a response is to a HEAD request and must not wait
+	// for body bytes that were never sent.
+	pendingMethods []string
+}
+
+// NewDumper returns a new Dumper.
+func NewDumper(logger *zap.Logger) *Dumper {
+	return &Dumper{
+		logger: logger,
+		conns:  dumper.NewConnStore[connState](),
+	}
+}
+
+// NewConnMetadata implements dumper.Dumper.
+func (d *Dumper) NewConnMetadata() *dumper.ConnMetadata {
+	return &dumper.ConnMetadata{
+		DumpValues: []dumper.DumpValue{},
+	}
+}
+
+// Read implements dumper.Dumper.
+func (d *Dumper) Read(in []byte, direction dumper.Direction, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	cs := d.conns.Get(connMetadata)
+
+	switch direction {
+	case dumper.SrcToDst:
+		cs.reqBuf = append(cs.reqBuf, in...)
+		return d.readRequest(cs, connMetadata)
+	case dumper.DstToSrc:
+		cs.resBuf = append(cs.resBuf, in...)
+		return d.readResponse(cs, connMetadata)
+	default:
+		return nil, nil
+	}
+}
+
+// isIncomplete reports whether err from http.ReadRequest/ReadResponse just
+// means the buffer doesn't hold a complete message yet, as opposed to one
+// that's fully buffered but malformed and will never parse.
+func isIncomplete(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, bufio.ErrBufferFull)
+}
+
+// readRequest parses every complete pipelined request at the front of
+// cs.reqBuf in a loop, rather than just the oldest one, so a burst of
+// pipelined requests delivered in a single reassembled chunk isn't left
+// sitting unparsed until some later, unrelated Read call.
+func (d *Dumper) readRequest(cs *connState, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	var pending []dumper.DumpValue
+	for {
+		br := newBufReader(cs.reqBuf)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			if isIncomplete(err) {
+				break
+			}
+			// the buffer is desynced with no way to resume framing -
+			// drop it rather than re-erroring on the same bytes forever
+			cs.reqBuf = nil
+			return pending, fmt.Errorf("http: malformed request: %w", err)
+		}
+
+		total, _, ok := messageLength(cs.reqBuf, br, req.Body)
+		if !ok {
+			// body (or, for chunked, its terminating "0\r\n\r\n") not fully
+			// buffered yet - wait for more data
+			break
+		}
+		cs.reqBuf = cs.reqBuf[total:]
+		cs.pendingMethods = append(cs.pendingMethods, req.Method)
+
+		if host := req.Header.Get("Host"); host != "" && host != cs.host {
+			cs.host = host
+			connMetadata.DumpValues = append(connMetadata.DumpValues, dumper.DumpValue{
+				Key:   "http_host",
+				Value: host,
+			})
+		}
+
+		values := []dumper.DumpValue{
+			{Key: "method", Value: req.Method},
+			{Key: "path", Value: req.URL.Path},
+		}
+		if pending != nil {
+			dumper.LogPending(d, pending, connMetadata)
+		}
+		pending = values
+	}
+	return pending, nil
+}
+
+// readResponse parses every complete pipelined response at the front of
+// cs.resBuf, the same way readRequest does for requests. It passes the
+// matching request's method (queued by readRequest in cs.pendingMethods)
+// into http.ReadResponse, not nil: net/http only special-cases a
+// zero-length HEAD response body via req.Method == "HEAD", and with a nil
+// req that check can never fire, so a HEAD response's Content-Length would
+// otherwise be read as a body that never arrives.
+func (d *Dumper) readResponse(cs *connState, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	var pending []dumper.DumpValue
+	for {
+		method := "GET"
+		if len(cs.pendingMethods) > 0 {
+			method = cs.pendingMethods[0]
+		}
+
+		br := newBufReader(cs.resBuf)
+		res, err := http.ReadResponse(br, &http.Request{Method: method})
+		if err != nil {
+			if isIncomplete(err) {
+				break
+			}
+			// the buffer is desynced with no way to resume framing -
+			// drop it rather than re-erroring on the same bytes forever
+			cs.resBuf = nil
+			return pending, fmt.Errorf("http: malformed response: %w", err)
+		}
+
+		total, size, ok := messageLength(cs.resBuf, br, res.Body)
+		if !ok {
+			break
+		}
+		cs.resBuf = cs.resBuf[total:]
+		if len(cs.pendingMethods) > 0 {
+			cs.pendingMethods = cs.pendingMethods[1:]
+		}
+
+		values := []dumper.DumpValue{
+			{Key: "status", Value: res.StatusCode},
+			{Key: "response_size", Value: size},
+		}
+		if pending != nil {
+			dumper.LogPending(d, pending, connMetadata)
+		}
+		pending = values
+	}
+	return pending, nil
+}
+
+// messageLength returns how many bytes of buf the request/response whose
+// header http.ReadRequest/ReadResponse just parsed off br occupies in
+// total (header + body), along with the body's own size. It drains body --
+// which net/http already wires to read exactly as many bytes as the
+// message actually has on the wire, whether that's governed by a fixed
+// Content-Length, chunked framing, or (for a response to a HEAD request,
+// or a 204/304) no body at all regardless of what Content-Length says --
+// rather than trusting a header field that a bodyless response can
+// legitimately disagree with. ok is false if body isn't fully buffered
+// yet.
+func messageLength(buf []byte, br *bufio.Reader, body io.ReadCloser) (total int, bodySize int64, ok bool) {
+	n, err := io.Copy(io.Discard, body)
+	if err != nil {
+		return 0, 0, false
+	}
+	return len(buf) - br.Buffered(), n, true
+}
+
+// Log implements dumper.Dumper.
+func (d *Dumper) Log(values []dumper.DumpValue) {
+	dumper.LogFields(d.logger, values)
+}
+
+// newBufReader wraps buf in a bufio.Reader sized to hold all of it in one
+// fill, so br.Buffered() afterwards reflects bytes left in buf itself
+// rather than bytes left in bufio's default 4096-byte fill window (which
+// would make messageLength overcount total whenever buf holds more than
+// that window).
+func newBufReader(buf []byte) *bufio.Reader {
+	return bufio.NewReaderSize(bytes.NewReader(buf), len(buf)+1)
+}
+
+// CloseConn implements the optional connCloser interface reader uses to
+// release per-connection state once a flow's reassembly is complete.
+func (d *Dumper) CloseConn(connMetadata *dumper.ConnMetadata) {
+	d.conns.CloseConn(connMetadata)
+}
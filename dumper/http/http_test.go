@@ -0,0 +1,149 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func assertDumpValue(t *testing.T, values []dumper.DumpValue, key string, want interface{}) {
+	t.Helper()
+	for _, v := range values {
+		if v.Key == key {
+			if v.Value != want {
+				t.Errorf("%s = %v, want %v", key, v.Value, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no %q DumpValue in %v", key, values)
+}
+
+func TestDumperReadRequestTruncatedHeader(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	got, err := d.Read([]byte("GET /a HTTP/1.1\r\nHost: exam"), dumper.SrcToDst, cm)
+	if got != nil || err != nil {
+		t.Fatalf("Read() = (%v, %v), want (nil, nil) for a truncated header", got, err)
+	}
+}
+
+func TestDumperReadRequestChunked(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	req := "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"4\r\nWiki\r\n5\r\npedia\r\n0\r\n\r\n"
+
+	got, err := d.Read([]byte(req), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() = nil, want the parsed chunked request")
+	}
+	assertDumpValue(t, got, "method", "POST")
+	assertDumpValue(t, got, "path", "/upload")
+}
+
+func TestDumperReadRequestChunkedSplitAcrossCalls(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	head := "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nWiki\r\n"
+	tail := "5\r\npedia\r\n0\r\n\r\n"
+
+	if got, err := d.Read([]byte(head), dumper.SrcToDst, cm); got != nil || err != nil {
+		t.Fatalf("Read() with an unterminated chunked body = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := d.Read([]byte(tail), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() after the chunked terminator err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() after the chunked terminator = nil, want dump values")
+	}
+	assertDumpValue(t, got, "path", "/upload")
+}
+
+func TestDumperReadPipelinedRequests(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	d := NewDumper(zap.New(core))
+	cm := d.NewConnMetadata()
+
+	reqs := "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+	got, err := d.Read([]byte(reqs), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() = nil, want the second pipelined request's dump values")
+	}
+	assertDumpValue(t, got, "path", "/b")
+	if logs.Len() != 1 {
+		t.Fatalf("logged %d records for the leading pipelined request, want 1", logs.Len())
+	}
+}
+
+func TestDumperReadResponseToHeadRequest(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	req := "HEAD /status HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	if got, err := d.Read([]byte(req), dumper.SrcToDst, cm); got == nil || err != nil {
+		t.Fatalf("Read() for the HEAD request = (%v, %v), want (dump values, nil)", got, err)
+	}
+
+	// A HEAD response legitimately carries Content-Length describing the
+	// resource with zero actual body bytes; without the queued method
+	// this would wait forever for a body that's never coming.
+	res := "HTTP/1.1 200 OK\r\nContent-Length: 1234\r\n\r\n"
+	got, err := d.Read([]byte(res), dumper.DstToSrc, cm)
+	if err != nil {
+		t.Fatalf("Read() for the HEAD response err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() for the HEAD response = nil, want dump values")
+	}
+	assertDumpValue(t, got, "status", 200)
+	assertDumpValue(t, got, "response_size", int64(0))
+}
+
+func TestDumperReadResponseSplitAcrossCalls(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	head := "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhel"
+	tail := "lo"
+
+	if got, err := d.Read([]byte(head), dumper.DstToSrc, cm); got != nil || err != nil {
+		t.Fatalf("Read() with a partial body = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := d.Read([]byte(tail), dumper.DstToSrc, cm)
+	if err != nil {
+		t.Fatalf("Read() after the body completes err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() after the body completes = nil, want dump values")
+	}
+	assertDumpValue(t, got, "status", 200)
+	assertDumpValue(t, got, "response_size", int64(5))
+}
+
+func TestDumperReadRequestMalformedReturnsError(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	got, err := d.Read([]byte("NOT A REQUEST\r\n\r\n"), dumper.SrcToDst, cm)
+	if err == nil {
+		t.Fatalf("Read() err = nil, want a parse error for a malformed request line")
+	}
+	if got != nil {
+		t.Errorf("Read() values = %v, want nil alongside the error", got)
+	}
+}
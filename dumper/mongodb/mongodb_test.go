@@ -0,0 +1,166 @@
+package mongodb
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// bsonStringElement builds a BSON UTF-8 string element ({name: value}).
+func bsonStringElement(name, value string) []byte {
+	var b []byte
+	b = append(b, 0x02) // element type: UTF-8 string
+	b = append(b, []byte(name)...)
+	b = append(b, 0x00) // cstring terminator
+
+	valBytes := append([]byte(value), 0x00)
+	lenBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBuf, uint32(len(valBytes)))
+	b = append(b, lenBuf...)
+	b = append(b, valBytes...)
+	return b
+}
+
+// bsonDoc wraps elements in a BSON document: int32 length + elements + a
+// trailing 0x00 terminator.
+func bsonDoc(elements ...[]byte) []byte {
+	var body []byte
+	for _, e := range elements {
+		body = append(body, e...)
+	}
+	body = append(body, 0x00)
+
+	lenBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBuf, uint32(4+len(body)))
+	return append(lenBuf, body...)
+}
+
+// wireMessage wraps body in a 16-byte wire protocol header (messageLength,
+// requestID, responseTo all computed/zeroed except messageLength and
+// opCode).
+func wireMessage(opCode int32, body []byte) []byte {
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(16+len(body)))
+	binary.LittleEndian.PutUint32(header[12:16], uint32(opCode))
+	return append(header, body...)
+}
+
+func opMsgMessage(doc []byte) []byte {
+	body := make([]byte, 0, 5+len(doc))
+	body = append(body, 0, 0, 0, 0) // flagBits
+	body = append(body, 0)          // section kind 0: body
+	body = append(body, doc...)
+	return wireMessage(opMsg, body)
+}
+
+func assertDumpValue(t *testing.T, values []dumper.DumpValue, key string, want interface{}) {
+	t.Helper()
+	for _, v := range values {
+		if v.Key == key {
+			if v.Value != want {
+				t.Errorf("%s = %v, want %v", key, v.Value, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no %q DumpValue in %v", key, values)
+}
+
+func TestNextMessage(t *testing.T) {
+	full := opMsgMessage(bsonDoc(bsonStringElement("find", "mycollection")))
+
+	buf := append([]byte{}, full...)
+	msg, ok, err := nextMessage(&buf)
+	if err != nil {
+		t.Fatalf("nextMessage() err = %v, want nil", err)
+	}
+	if !ok {
+		t.Fatalf("nextMessage() ok = false, want true")
+	}
+	if len(msg) != len(full) {
+		t.Errorf("len(msg) = %d, want %d", len(msg), len(full))
+	}
+	if len(buf) != 0 {
+		t.Errorf("len(remaining buf) = %d, want 0", len(buf))
+	}
+
+	truncated := full[:len(full)-1]
+	if _, ok, err := nextMessage(&truncated); ok || err != nil {
+		t.Errorf("nextMessage() on a truncated message = (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+
+	tooShort := full[:10]
+	if _, ok, err := nextMessage(&tooShort); ok || err != nil {
+		t.Errorf("nextMessage() on a header shorter than 16 bytes = (ok=%v, err=%v), want (false, nil)", ok, err)
+	}
+
+	invalidLength := append([]byte{}, full...)
+	binary.LittleEndian.PutUint32(invalidLength[0:4], 10) // < 16, never valid
+	if _, ok, err := nextMessage(&invalidLength); ok || err == nil {
+		t.Errorf("nextMessage() on an invalid messageLength = (ok=%v, err=%v), want (false, non-nil)", ok, err)
+	}
+}
+
+func TestDumperReadSplitAcrossCalls(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	full := opMsgMessage(bsonDoc(bsonStringElement("find", "mycollection")))
+	head, tail := full[:10], full[10:]
+
+	if got, err := d.Read(head, dumper.SrcToDst, cm); got != nil || err != nil {
+		t.Fatalf("Read() with a partial message = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := d.Read(tail, dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() after completing the message err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() after completing the message = nil, want dump values")
+	}
+	assertDumpValue(t, got, "mongodb_command", "find")
+	assertDumpValue(t, got, "mongodb_collection", "mycollection")
+}
+
+func TestDumperReadPipelinedMessages(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	d := NewDumper(zap.New(core))
+	cm := d.NewConnMetadata()
+
+	first := opMsgMessage(bsonDoc(bsonStringElement("find", "mycollection")))
+	second := opMsgMessage(bsonDoc(bsonStringElement("find", "othercollection")))
+
+	got, err := d.Read(append(append([]byte{}, first...), second...), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() = nil, want the second pipelined message's dump values")
+	}
+	assertDumpValue(t, got, "mongodb_collection", "othercollection")
+	if logs.Len() != 1 {
+		t.Fatalf("logged %d records for the leading pipelined message, want 1", logs.Len())
+	}
+}
+
+func TestDumperReadHandshakeRecordedOnce(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	handshake := opMsgMessage(bsonDoc(bsonStringElement("isMaster", "1")))
+	d.Read(handshake, dumper.SrcToDst, cm)
+	d.Read(handshake, dumper.SrcToDst, cm)
+
+	count := 0
+	for _, v := range cm.DumpValues {
+		if v.Key == "mongodb_handshake" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("mongodb_handshake recorded %d times, want 1", count)
+	}
+}
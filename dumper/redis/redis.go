@@ -0,0 +1,184 @@
+// Package redis implements dumper.Dumper for the Redis RESP2 protocol,
+// decoding inline and multi-bulk commands into command/args dump values.
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+)
+
+// Dumper is a dumper.Dumper for Redis RESP2 commands.
+type Dumper struct {
+	logger *zap.Logger
+	conns  *dumper.ConnStore[connState]
+}
+
+// connState holds the buffered, not-yet-complete command bytes for a
+// single connection.
+type connState struct {
+	buf []byte
+	db  string
+}
+
+// NewDumper returns a new Dumper.
+func NewDumper(logger *zap.Logger) *Dumper {
+	return &Dumper{
+		logger: logger,
+		conns:  dumper.NewConnStore[connState](),
+	}
+}
+
+// NewConnMetadata implements dumper.Dumper.
+func (d *Dumper) NewConnMetadata() *dumper.ConnMetadata {
+	return &dumper.ConnMetadata{
+		DumpValues: []dumper.DumpValue{},
+	}
+}
+
+// Read implements dumper.Dumper. Only client-to-server traffic is parsed;
+// replies are not decoded. A pipelined batch of commands arriving in one
+// reassembled chunk is parsed in a loop rather than just the oldest one,
+// so trailing pipelined commands aren't left to a later, unrelated Read
+// call (or dropped for good, if the client never sends anything after).
+func (d *Dumper) Read(in []byte, direction dumper.Direction, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	if direction != dumper.SrcToDst {
+		return nil, nil
+	}
+
+	cs := d.conns.Get(connMetadata)
+	cs.buf = append(cs.buf, in...)
+
+	var pending []dumper.DumpValue
+	for {
+		args, consumed, ok, err := parseCommand(cs.buf)
+		if err != nil {
+			// the buffer is desynced with no way to resume framing -
+			// drop it rather than re-erroring on the same bytes forever
+			cs.buf = nil
+			return pending, err
+		}
+		if !ok {
+			break
+		}
+		cs.buf = cs.buf[consumed:]
+		if len(args) == 0 {
+			continue
+		}
+
+		values := d.handleCommand(cs, args, connMetadata)
+		if pending != nil {
+			dumper.LogPending(d, pending, connMetadata)
+		}
+		pending = values
+	}
+	return pending, nil
+}
+
+func (d *Dumper) handleCommand(cs *connState, args []string, connMetadata *dumper.ConnMetadata) []dumper.DumpValue {
+	command := strings.ToUpper(args[0])
+	switch command {
+	case "SELECT":
+		if len(args) > 1 && args[1] != cs.db {
+			cs.db = args[1]
+			connMetadata.DumpValues = append(connMetadata.DumpValues, dumper.DumpValue{
+				Key:   "redis_db",
+				Value: args[1],
+			})
+		}
+	case "AUTH":
+		connMetadata.DumpValues = append(connMetadata.DumpValues, dumper.DumpValue{
+			Key:   "redis_auth",
+			Value: true,
+		})
+	}
+
+	return []dumper.DumpValue{
+		{Key: "command", Value: command},
+		{Key: "args", Value: args[1:]},
+	}
+}
+
+// Log implements dumper.Dumper.
+func (d *Dumper) Log(values []dumper.DumpValue) {
+	dumper.LogFields(d.logger, values)
+}
+
+// parseCommand decodes a single RESP2 command (inline or multi-bulk) from
+// the front of buf, returning its arguments and the number of bytes
+// consumed. ok is false when buf doesn't yet hold a complete command; err
+// is non-nil when buf holds a complete but malformed multi-bulk command,
+// which (unlike an incomplete one) will never become parseable by waiting
+// for more bytes.
+func parseCommand(buf []byte) (args []string, consumed int, ok bool, err error) {
+	if len(buf) == 0 {
+		return nil, 0, false, nil
+	}
+	if buf[0] != '*' {
+		args, consumed, ok = parseInline(buf)
+		return args, consumed, ok, nil
+	}
+	return parseMultiBulk(buf)
+}
+
+func parseInline(buf []byte) ([]string, int, bool) {
+	idx := bytes.IndexByte(buf, '\n')
+	if idx < 0 {
+		return nil, 0, false
+	}
+	line := strings.TrimRight(string(buf[:idx]), "\r\n")
+	return strings.Fields(line), idx + 1, true
+}
+
+func parseMultiBulk(buf []byte) (args []string, consumed int, ok bool, err error) {
+	idx := bytes.IndexByte(buf, '\n')
+	if idx < 0 {
+		return nil, 0, false, nil
+	}
+	n, convErr := strconv.Atoi(strings.TrimSpace(string(buf[1:idx])))
+	if convErr != nil || n <= 0 {
+		return nil, idx + 1, true, nil
+	}
+
+	pos := idx + 1
+	args = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if pos >= len(buf) {
+			return nil, 0, false, nil
+		}
+		if buf[pos] != '$' {
+			return nil, 0, false, fmt.Errorf("redis: expected '$' at offset %d, got %q", pos, buf[pos])
+		}
+		lenEnd := bytes.IndexByte(buf[pos:], '\n')
+		if lenEnd < 0 {
+			return nil, 0, false, nil
+		}
+		lenEnd += pos
+		argLen, convErr := strconv.Atoi(strings.TrimSpace(string(buf[pos+1 : lenEnd])))
+		if convErr != nil {
+			return nil, 0, false, fmt.Errorf("redis: invalid bulk length: %w", convErr)
+		}
+		if argLen < 0 {
+			return nil, 0, false, fmt.Errorf("redis: negative bulk length %d", argLen)
+		}
+
+		start := lenEnd + 1
+		end := start + argLen
+		if end+2 > len(buf) {
+			return nil, 0, false, nil
+		}
+		args = append(args, string(buf[start:end]))
+		pos = end + 2
+	}
+	return args, pos, true, nil
+}
+
+// CloseConn implements the optional connCloser interface reader uses to
+// release per-connection state once a flow's reassembly is complete.
+func (d *Dumper) CloseConn(connMetadata *dumper.ConnMetadata) {
+	d.conns.CloseConn(connMetadata)
+}
@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/k1LoW/tcpdp/dumper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		name         string
+		buf          string
+		wantArgs     []string
+		wantConsumed int
+		wantOK       bool
+		wantErr      bool
+	}{
+		{"inline command", "PING\r\n", []string{"PING"}, 6, true, false},
+		{"multi-bulk command", "*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n", []string{"GET", "foo"}, 22, true, false},
+		{"truncated inline command", "PING", nil, 0, false, false},
+		{"truncated multi-bulk argument", "*2\r\n$3\r\nGET\r\n$3\r\nfo", nil, 0, false, false},
+		{"truncated multi-bulk count", "*2", nil, 0, false, false},
+		{"multi-bulk missing $ prefix", "*1\r\n:3\r\nGET\r\n", nil, 0, false, true},
+		{"multi-bulk invalid bulk length", "*1\r\n$x\r\nGET\r\n", nil, 0, false, true},
+		{"multi-bulk negative bulk length", "*1\r\n$-2\r\nGET\r\n", nil, 0, false, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			args, consumed, ok, err := parseCommand([]byte(c.buf))
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, want non-nil: %v", err, c.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if ok != c.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, c.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if consumed != c.wantConsumed {
+				t.Errorf("consumed = %d, want %d", consumed, c.wantConsumed)
+			}
+			if !reflect.DeepEqual(args, c.wantArgs) {
+				t.Errorf("args = %v, want %v", args, c.wantArgs)
+			}
+		})
+	}
+}
+
+func assertDumpValue(t *testing.T, values []dumper.DumpValue, key string, want interface{}) {
+	t.Helper()
+	for _, v := range values {
+		if v.Key == key {
+			if v.Value != want {
+				t.Errorf("%s = %v, want %v", key, v.Value, want)
+			}
+			return
+		}
+	}
+	t.Errorf("no %q DumpValue in %v", key, values)
+}
+
+func TestDumperReadSplitAcrossCalls(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	if got, err := d.Read([]byte("*2\r\n$3\r\nGET\r\n$3\r"), dumper.SrcToDst, cm); got != nil || err != nil {
+		t.Fatalf("Read() with a partial command = (%v, %v), want (nil, nil)", got, err)
+	}
+	got, err := d.Read([]byte("\nfoo\r\n"), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() after completing the command err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() after completing the command = nil, want dump values")
+	}
+	assertDumpValue(t, got, "command", "GET")
+}
+
+func TestDumperReadPipelinedCommands(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	d := NewDumper(zap.New(core))
+	cm := d.NewConnMetadata()
+
+	got, err := d.Read([]byte("PING\r\nSET\r\n"), dumper.SrcToDst, cm)
+	if err != nil {
+		t.Fatalf("Read() err = %v, want nil", err)
+	}
+	if got == nil {
+		t.Fatalf("Read() = nil, want the second pipelined command's dump values")
+	}
+	assertDumpValue(t, got, "command", "SET")
+	if logs.Len() != 1 {
+		t.Fatalf("logged %d records for the leading pipelined command, want 1", logs.Len())
+	}
+}
+
+func TestDumperReadMalformedMultiBulkReturnsError(t *testing.T) {
+	d := NewDumper(zap.NewNop())
+	cm := d.NewConnMetadata()
+
+	got, err := d.Read([]byte("*1\r\n:3\r\nGET\r\n"), dumper.SrcToDst, cm)
+	if err == nil {
+		t.Fatalf("Read() err = nil, want a parse error for a multi-bulk command missing its '$' prefix")
+	}
+	if got != nil {
+		t.Errorf("Read() values = %v, want nil alongside the error", got)
+	}
+}
@@ -0,0 +1,12 @@
+// Package procs correlates a local 4-tuple (ip/port) with the local
+// process that owns the socket, by reading /proc/net/{tcp,tcp6} and
+// /proc/<pid>/fd the way Packetbeat's procs subsystem does. It is only
+// implemented on Linux; other platforms get a stub that always misses.
+package procs
+
+// ProcInfo describes the local process that owns a socket.
+type ProcInfo struct {
+	Pid  int
+	Comm string
+	User string
+}
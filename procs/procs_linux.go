@@ -0,0 +1,210 @@
+//go:build linux
+// +build linux
+
+package procs
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	mu         sync.Mutex
+	inodeToPid = map[string]int{}
+
+	refreshOnce sync.Once
+)
+
+// refreshInterval bounds how often refreshInodeTable walks /proc/<pid>/fd
+// for every process on the host. It runs on its own ticker, independent of
+// Lookup's call rate, so Lookup -- called synchronously from the
+// reassembly hot path for every new connection, where a cache miss is the
+// common case -- doesn't block on a full-host /proc walk itself, except for
+// the first Lookup, which builds the initial table before returning.
+const refreshInterval = 2 * time.Second
+
+// Lookup resolves the local process bound to ip:port from the inode->pid
+// table, which is kept warm by a background refresh loop rather than
+// rebuilt inline on every cache miss.
+func Lookup(ip net.IP, port uint16) (*ProcInfo, bool) {
+	startRefresh()
+
+	inode, ok := findSocketInode(ip, port)
+	if !ok {
+		return nil, false
+	}
+
+	mu.Lock()
+	pid, ok := inodeToPid[inode]
+	mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	return lookupProcInfo(pid)
+}
+
+// startRefresh starts the background inodeToPid refresh loop the first
+// time Lookup is called; it runs for the life of the process.
+func startRefresh() {
+	refreshOnce.Do(func() {
+		refreshInodeTable()
+		go func() {
+			t := time.NewTicker(refreshInterval)
+			defer t.Stop()
+			for range t.C {
+				refreshInodeTable()
+			}
+		}()
+	})
+}
+
+func findSocketInode(ip net.IP, port uint16) (string, bool) {
+	path := "/proc/net/tcp"
+	if ip.To4() == nil {
+		path = "/proc/net/tcp6"
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	for i, line := range strings.Split(string(b), "\n") {
+		if i == 0 || line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		localIP, localPort, ok := parseHexAddr(fields[1])
+		if !ok || localPort != port || !localIP.Equal(ip) {
+			continue
+		}
+		return fields[9], true
+	}
+	return "", false
+}
+
+// parseHexAddr parses the "IP:PORT" field of /proc/net/tcp{,6}, where the
+// address is hex-encoded in host byte order per 32-bit word.
+func parseHexAddr(field string) (net.IP, uint16, bool) {
+	parts := strings.SplitN(field, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, false
+	}
+	hexIP, hexPort := parts[0], parts[1]
+
+	raw, ok := decodeHex(hexIP)
+	if !ok {
+		return nil, 0, false
+	}
+
+	ip := make(net.IP, len(raw))
+	for w := 0; w+4 <= len(raw); w += 4 {
+		ip[w], ip[w+1], ip[w+2], ip[w+3] = raw[w+3], raw[w+2], raw[w+1], raw[w]
+	}
+
+	portVal, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	return ip, uint16(portVal), true
+}
+
+func decodeHex(s string) ([]byte, bool) {
+	if len(s)%2 != 0 {
+		return nil, false
+	}
+	out := make([]byte, len(s)/2)
+	for i := 0; i < len(out); i++ {
+		v, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return nil, false
+		}
+		out[i] = byte(v)
+	}
+	return out, true
+}
+
+// refreshInodeTable walks /proc/<pid>/fd, mapping each "socket:[inode]"
+// symlink it finds back to that pid.
+func refreshInodeTable() {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+
+	table := map[string]int{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/%s", pid, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			table[inode] = pid
+		}
+	}
+
+	mu.Lock()
+	inodeToPid = table
+	mu.Unlock()
+}
+
+func lookupProcInfo(pid int) (*ProcInfo, bool) {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return nil, false
+	}
+
+	info := &ProcInfo{
+		Pid:  pid,
+		Comm: strings.TrimSpace(string(comm)),
+	}
+
+	if uid, ok := readUID(pid); ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			info.User = u.Username
+		}
+	}
+
+	return info, true
+}
+
+func readUID(pid int) (int, bool) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return 0, false
+		}
+		uid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, false
+		}
+		return uid, true
+	}
+	return 0, false
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package procs
+
+import "net"
+
+// Lookup always misses on non-Linux platforms; /proc is Linux-specific.
+func Lookup(ip net.IP, port uint16) (*ProcInfo, bool) {
+	return nil, false
+}
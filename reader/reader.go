@@ -2,31 +2,54 @@ package reader
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
 	"github.com/k1LoW/tcpdp/dumper"
-	"github.com/rs/xid"
+	"github.com/k1LoW/tcpdp/metrics"
 	"go.uber.org/zap"
 )
 
 const anyIP = "0.0.0.0"
+const anyIPv6 = "::"
 
-var maxPacketLen = 0xFFFF // 65535
+// streamCloseTimeout is how long a flow can sit idle in the assembler
+// before it is force-flushed and its Stream torn down.
+const streamCloseTimeout = 90 * time.Second
 
-// ParseTarget parse target to host:port
+// ParseTarget parse target to host:port. Both IPv4 and IPv6 hosts are
+// supported; an IPv6 host:port must be bracketed (e.g. "[::1]:3306") the
+// same way Go's net package requires, while a bare IPv6 literal (e.g.
+// "::1") is accepted as a host with no port.
 func ParseTarget(target string) (string, uint16, error) {
 	var port uint16
 	var host string
 	if target == "" {
 		host = ""
 		port = uint16(0)
+	} else if strings.HasPrefix(target, "[") {
+		h, p, err := net.SplitHostPort(target)
+		if err != nil {
+			host = strings.Trim(target, "[]")
+			return host, uint16(0), nil
+		}
+		port64, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return "", uint16(0), nil
+		}
+		host = h
+		port = uint16(port64)
+	} else if ip := net.ParseIP(target); ip != nil {
+		// bare IP literal with no port (IPv4 or unbracketed IPv6)
+		host = target
+		port = uint16(0)
 	} else if strings.Contains(target, ":") {
 		tAddr, err := net.ResolveTCPAddr("tcp", target)
 		if err != nil {
@@ -50,12 +73,18 @@ func ParseTarget(target string) (string, uint16, error) {
 
 // NewBPFFilterString return string for BPF
 func NewBPFFilterString(host string, port uint16) string {
-	f := fmt.Sprintf("tcp and host %s and port %d", host, port)
-	if (host == "" || host == anyIP) && port > 0 {
+	isAny := host == "" || host == anyIP || host == anyIPv6
+	proto := "tcp"
+	if strings.Contains(host, ":") {
+		proto = "tcp and ip6"
+	}
+
+	f := fmt.Sprintf("%s and host %s and port %d", proto, host, port)
+	if isAny && port > 0 {
 		f = fmt.Sprintf("tcp port %d", port)
-	} else if (host != "" && host != anyIP) && port == 0 {
-		f = fmt.Sprintf("tcp and host %s", host)
-	} else if (host == "" || host == anyIP) && port == 0 {
+	} else if !isAny && port == 0 {
+		f = fmt.Sprintf("%s and host %s", proto, host)
+	} else if isAny && port == 0 {
 		f = "tcp"
 	}
 	return f
@@ -70,6 +99,10 @@ type PacketReader struct {
 	pValues      []dumper.DumpValue
 	logger       *zap.Logger
 	packetBuffer chan gopacket.Packet
+	assembler    *reassembly.Assembler
+	done         chan struct{} // closed once handlePacket returns
+
+	packetsProcessed int64 // atomic; only used to report offline replay throughput
 }
 
 // NewPacketReader return PacketReader
@@ -92,6 +125,7 @@ func NewPacketReader(
 		pValues:      pValues,
 		logger:       logger,
 		packetBuffer: internalPacketBuffer,
+		done:         make(chan struct{}),
 	}
 
 	return reader
@@ -101,7 +135,11 @@ func NewPacketReader(
 func (r *PacketReader) ReadAndDump(host string, port uint16) error {
 	packetChan := r.packetSource.Packets()
 
-	go r.handlePacket(host, port)
+	streamFactory := &tcpStreamFactory{reader: r, host: host, port: port}
+	streamPool := reassembly.NewStreamPool(streamFactory)
+	r.assembler = reassembly.NewAssembler(streamPool)
+
+	go r.handlePacket(time.NewTicker(streamCloseTimeout / 3))
 	go r.checkBufferdPacket(packetChan)
 
 	for {
@@ -114,187 +152,122 @@ func (r *PacketReader) ReadAndDump(host string, port uint16) error {
 	}
 }
 
-func (r *PacketReader) handlePacket(host string, port uint16) error {
-	mMap := map[string]*dumper.ConnMetadata{}        // metadata map per connection
-	mssMap := map[string]int{}                       // TCP MSS map per connection
-	bMap := map[string]map[dumper.Direction][]byte{} // long payload map per direction
+// handlePacket owns r.assembler for the lifetime of the capture: it is the
+// only goroutine that ever calls into it, since reassembly.Assembler isn't
+// safe for concurrent use. flushTicker, when non-nil, periodically closes
+// out flows idle longer than streamCloseTimeout on this same goroutine
+// instead of a separate one racing against AssembleWithContext.
+func (r *PacketReader) handlePacket(flushTicker *time.Ticker) error {
+	defer close(r.done)
+
+	var flushC <-chan time.Time
+	if flushTicker != nil {
+		defer flushTicker.Stop()
+		flushC = flushTicker.C
+	}
 
 	for {
 		select {
 		case <-r.ctx.Done():
 			return nil
+		case now := <-flushC:
+			r.assembler.FlushCloseOlderThan(now.Add(-streamCloseTimeout))
 		case packet := <-r.packetBuffer:
 			if packet == nil {
+				// packetChan closed (offline replay hit EOF, or the live
+				// source errored out): flush every flow still open in the
+				// assembler so it gets a final ReassembledSG/
+				// ReassemblyComplete instead of being silently dropped.
+				r.assembler.FlushAll()
+				metrics.PacketsDroppedTotal.WithLabelValues("nil_packet").Inc()
 				r.cancel()
 				return nil
 			}
-			ipLayer := packet.Layer(layers.LayerTypeIPv4)
-			if ipLayer == nil {
-				continue
-			}
 			tcpLayer := packet.Layer(layers.LayerTypeTCP)
 			if tcpLayer == nil {
 				continue
 			}
-			ip, _ := ipLayer.(*layers.IPv4)
 			tcp, _ := tcpLayer.(*layers.TCP)
 
-			var key string
-			var direction dumper.Direction
-			srcToDstKey := fmt.Sprintf("%s:%d->%s:%d", ip.SrcIP.String(), tcp.SrcPort, ip.DstIP.String(), tcp.DstPort)
-			dstToSrcKey := fmt.Sprintf("%s:%d->%s:%d", ip.DstIP.String(), tcp.DstPort, ip.SrcIP.String(), tcp.SrcPort)
-			if (host == "" || ip.DstIP.String() == host) && uint16(tcp.DstPort) == port {
-				key = srcToDstKey
-				direction = dumper.SrcToDst
-			} else if (host == "" || ip.SrcIP.String() == host) && uint16(tcp.SrcPort) == port {
-				key = dstToSrcKey
-				direction = dumper.DstToSrc
+			var netFlow gopacket.Flow
+			if ip4Layer := packet.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+				netFlow = ip4Layer.(*layers.IPv4).NetworkFlow()
+			} else if ip6Layer := packet.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+				netFlow = ip6Layer.(*layers.IPv6).NetworkFlow()
 			} else {
-				key = "-"
-				direction = dumper.Unknown
+				continue
 			}
 
-			if tcp.SYN && !tcp.ACK {
-				if direction == dumper.Unknown {
-					key = srcToDstKey
-				}
-
-				// TCP connection start
-				_, ok := mMap[key]
-				if ok {
-					delete(mMap, key)
-				}
+			ac := &assemblerContext{CaptureInfo: packet.Metadata().CaptureInfo}
+			r.assembler.AssembleWithContext(netFlow, tcp, ac)
+			atomic.AddInt64(&r.packetsProcessed, 1)
+		}
+	}
+}
 
-				// TCP connection start ( hex, mysql, pg )
-				connID := xid.New().String()
-				mss := int(binary.BigEndian.Uint16(tcp.LayerContents()[22:24]))
-				connMetadata := r.dumper.NewConnMetadata()
-				connMetadata.DumpValues = []dumper.DumpValue{
-					dumper.DumpValue{
-						Key:   "conn_id",
-						Value: connID,
-					},
-				}
-				mMap[key] = connMetadata
-				mssMap[key] = mss
-				bMap[key] = newByteMap()
-			} else if tcp.SYN && tcp.ACK {
-				if direction == dumper.Unknown {
-					key = dstToSrcKey
-				}
+// ReadOffline drives the same reassembly/dumper pipeline as ReadAndDump,
+// but over a PacketSource built from an archived capture (e.g.
+// pcap.OpenOffline) instead of a live interface. Capture timestamps are
+// not real-time, so instead of the live buffered-packet backpressure
+// check it reports throughput, and an optional speed multiplier paces
+// delivery by the packets' own CaptureInfo.Timestamp.
+func (r *PacketReader) ReadOffline(host string, port uint16, speed float64) error {
+	packetChan := r.packetSource.Packets()
 
-				_, ok := mMap[key]
-				if !ok {
-					// TCP connection start ( hex, mysql, pg )
-					connID := xid.New().String()
-					connMetadata := r.dumper.NewConnMetadata()
-					connMetadata.DumpValues = []dumper.DumpValue{
-						dumper.DumpValue{
-							Key:   "conn_id",
-							Value: connID,
-						},
-					}
-					mMap[key] = connMetadata
-				}
+	streamFactory := &tcpStreamFactory{reader: r, host: host, port: port}
+	streamPool := reassembly.NewStreamPool(streamFactory)
+	r.assembler = reassembly.NewAssembler(streamPool)
 
-				mss := int(binary.BigEndian.Uint16(tcp.LayerContents()[22:24]))
-				current, ok := mssMap[key]
-				if !ok || mss < current {
-					mssMap[key] = mss
-				}
-				mMap[key].DumpValues = append(mMap[key].DumpValues, dumper.DumpValue{
-					Key:   "mss",
-					Value: mss,
-				})
-			} else if tcp.FIN {
-				// TCP connection end
-				_, ok := mMap[key]
-				if ok {
-					delete(mMap, key)
-				}
-				_, ok = mssMap[key]
-				if ok {
-					delete(mssMap, key)
-				}
-				_, ok = bMap[key]
-				if ok {
-					delete(bMap, key)
-				}
-				if direction == dumper.Unknown {
-					for _, key := range []string{srcToDstKey, dstToSrcKey} {
-						_, ok := mMap[key]
-						if ok {
-							delete(mMap, key)
-						}
-					}
-				}
-			}
+	go r.handlePacket(nil)
+	go r.reportOfflineProgress()
 
-			_, ok := bMap[key]
+	var lastTimestamp time.Time
+	for {
+		select {
+		case <-r.ctx.Done():
+			return nil
+		case packet, ok := <-packetChan:
 			if !ok {
-				bMap[key] = newByteMap()
-			}
-
-			in := tcpLayer.LayerPayload()
-			if len(in) == 0 {
-				continue
-			}
-
-			mss, ok := mssMap[key]
-			if ok {
-				maxPacketLen = mss - (len(tcp.LayerContents()) - 20)
-			}
-			if len(in) == maxPacketLen {
-				bMap[key][direction] = append(bMap[key][direction], in...)
-				continue
-			}
-			bb, ok := bMap[key][direction]
-			if ok {
-				in = append(bb, in...)
-				bMap[key][direction] = nil
+				// Send the EOF sentinel and wait for handlePacket to
+				// actually drain it (and call FlushAll) before returning:
+				// replayFile's deferred cancel() fires right after this
+				// call returns, and handlePacket's select would otherwise
+				// be free to pick <-r.ctx.Done() over the still-queued
+				// sentinel once that happens, skipping the final flush.
+				r.packetBuffer <- nil
+				<-r.done
+				return nil
 			}
-			if direction == dumper.Unknown {
-				for _, k := range []string{srcToDstKey, dstToSrcKey} {
-					_, ok := mMap[k]
-					if ok {
-						key = k
+			if speed > 0 {
+				ts := packet.Metadata().CaptureInfo.Timestamp
+				if !lastTimestamp.IsZero() {
+					if wait := time.Duration(float64(ts.Sub(lastTimestamp)) / speed); wait > 0 {
+						time.Sleep(wait)
 					}
 				}
+				lastTimestamp = ts
 			}
+			r.packetBuffer <- packet
+		}
+	}
+}
 
-			connMetadata, ok := mMap[key]
-			if !ok {
-				connMetadata = r.dumper.NewConnMetadata()
-			}
-
-			ts := packet.Metadata().CaptureInfo.Timestamp
-
-			values := []dumper.DumpValue{
-				dumper.DumpValue{
-					Key:   "ts",
-					Value: ts,
-				},
-				dumper.DumpValue{
-					Key:   "src_addr",
-					Value: fmt.Sprintf("%s:%d", ip.SrcIP.String(), tcp.SrcPort),
-				},
-				dumper.DumpValue{
-					Key:   "dst_addr",
-					Value: fmt.Sprintf("%s:%d", ip.DstIP.String(), tcp.DstPort),
-				},
-			}
-
-			read := r.dumper.Read(in, direction, connMetadata)
-			mMap[key] = connMetadata
-			if len(read) == 0 {
-				continue
-			}
-
-			values = append(values, read...)
-			values = append(values, r.pValues...)
-			values = append(values, connMetadata.DumpValues...)
+// reportOfflineProgress logs packets processed per second, since the
+// buffered-packet-stats check in checkBufferdPacket is meaningless when
+// packets aren't arriving in real time.
+func (r *PacketReader) reportOfflineProgress() {
+	t := time.NewTicker(1 * time.Second)
+	defer t.Stop()
 
-			r.dumper.Log(values)
+	var last int64
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-t.C:
+			processed := atomic.LoadInt64(&r.packetsProcessed)
+			r.logger.Info("offline replay progress", zap.Int64("packets_per_second", processed-last))
+			last = processed
 		}
 	}
 }
@@ -309,6 +282,11 @@ L:
 		case <-t.C:
 			gopacketBuffered := len(packetChan)
 			internalPacketBuffered := len(r.packetBuffer)
+
+			metrics.GopacketChannelDepth.Set(float64(gopacketBuffered))
+			metrics.InternalBufferDepth.Set(float64(internalPacketBuffered))
+			metrics.InternalBufferCapacity.Set(float64(cap(r.packetBuffer)))
+
 			if internalPacketBuffered > (cap(r.packetBuffer)/10) || gopacketBuffered > (cap(packetChan)/10) {
 				r.logger.Info("buffered packet stats", zap.Int("internal_buffered", internalPacketBuffered), zap.Int("gopacket_buffered", gopacketBuffered))
 			}
@@ -316,11 +294,3 @@ L:
 	}
 	t.Stop()
 }
-
-func newByteMap() map[dumper.Direction][]byte {
-	return map[dumper.Direction][]byte{
-		dumper.SrcToDst: []byte{},
-		dumper.DstToSrc: []byte{},
-		dumper.Unknown:  []byte{},
-	}
-}
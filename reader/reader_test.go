@@ -0,0 +1,60 @@
+package reader
+
+import "testing"
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		name     string
+		target   string
+		wantHost string
+		wantPort uint16
+	}{
+		{"empty target", "", "", 0},
+		{"IPv4 host and port", "10.0.0.2:3306", "10.0.0.2", 3306},
+		{"IPv4 host only", "10.0.0.2", "10.0.0.2", 0},
+		{"port only", "3306", "", 3306},
+		{"bracketed IPv6 host and port", "[::1]:3306", "::1", 3306},
+		{"bare IPv6 host, no port", "::1", "::1", 0},
+		{"bracketed IPv6 any address", "[::]:3306", "::", 3306},
+		{"bare IPv6 any address", "::", "::", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			host, port, err := ParseTarget(c.target)
+			if err != nil {
+				t.Fatalf("ParseTarget(%q) err = %v, want nil", c.target, err)
+			}
+			if host != c.wantHost {
+				t.Errorf("ParseTarget(%q) host = %q, want %q", c.target, host, c.wantHost)
+			}
+			if port != c.wantPort {
+				t.Errorf("ParseTarget(%q) port = %d, want %d", c.target, port, c.wantPort)
+			}
+		})
+	}
+}
+
+func TestNewBPFFilterString(t *testing.T) {
+	cases := []struct {
+		name string
+		host string
+		port uint16
+		want string
+	}{
+		{"IPv4 host and port", "10.0.0.2", 3306, "tcp and host 10.0.0.2 and port 3306"},
+		{"IPv4 any host", anyIP, 3306, "tcp port 3306"},
+		{"IPv6 host and port", "::1", 3306, "tcp and ip6 and host ::1 and port 3306"},
+		{"IPv6 host, no port", "::1", 0, "tcp and ip6 and host ::1"},
+		{"IPv6 any host", anyIPv6, 3306, "tcp port 3306"},
+		{"no host or port", "", 0, "tcp"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := NewBPFFilterString(c.host, c.port); got != c.want {
+				t.Errorf("NewBPFFilterString(%q, %d) = %q, want %q", c.host, c.port, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package reader
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/k1LoW/tcpdp/dumper"
+	"github.com/k1LoW/tcpdp/metrics"
+	"github.com/k1LoW/tcpdp/procs"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// assemblerContext implements reassembly.AssemblerContext, carrying the
+// CaptureInfo of the packet currently being fed to the assembler.
+type assemblerContext struct {
+	CaptureInfo gopacket.CaptureInfo
+}
+
+func (ctx *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return ctx.CaptureInfo
+}
+
+// tcpStreamFactory implements reassembly.StreamFactory. It creates one
+// tcpStream per TCP flow and assigns it the conn_id/mss bookkeeping that
+// used to live in handlePacket's SYN/SYN+ACK handling.
+type tcpStreamFactory struct {
+	reader *PacketReader
+	host   string
+	port   uint16
+}
+
+// New implements reassembly.StreamFactory.
+func (f *tcpStreamFactory) New(netFlow, transport gopacket.Flow, tcp *layers.TCP, ac reassembly.AssemblerContext) reassembly.Stream {
+	connID := xid.New().String()
+	connMetadata := f.reader.dumper.NewConnMetadata()
+	connMetadata.DumpValues = []dumper.DumpValue{
+		dumper.DumpValue{
+			Key:   "conn_id",
+			Value: connID,
+		},
+	}
+	if mss, ok := mssOption(tcp); ok {
+		connMetadata.DumpValues = append(connMetadata.DumpValues, dumper.DumpValue{
+			Key:   "mss",
+			Value: mss,
+		})
+	}
+	addLocalProcDumpValues(netFlow, tcp, connMetadata)
+
+	direction := f.direction(netFlow, tcp)
+	metrics.ActiveConnections.Inc()
+	metrics.TCPFlagsObservedTotal.WithLabelValues("syn", directionLabel(direction)).Inc()
+
+	return &tcpStream{
+		reader:       f.reader,
+		net:          netFlow,
+		transport:    transport,
+		direction:    direction,
+		connMetadata: connMetadata,
+	}
+}
+
+// directionLabel renders a dumper.Direction as a Prometheus label value.
+func directionLabel(d dumper.Direction) string {
+	switch d {
+	case dumper.SrcToDst:
+		return "src_to_dst"
+	case dumper.DstToSrc:
+		return "dst_to_src"
+	default:
+		return "unknown"
+	}
+}
+
+// direction decides which logical direction (SrcToDst/DstToSrc/Unknown) the
+// client-to-server side of this flow corresponds to, based on the
+// configured probe target. It mirrors the host/port matching handlePacket
+// used to perform on SYN before reassembly existed, generalized to compare
+// net.IP values so IPv4 and IPv6 targets both work.
+func (f *tcpStreamFactory) direction(netFlow gopacket.Flow, tcp *layers.TCP) dumper.Direction {
+	srcIP, dstIP := flowIPs(netFlow)
+	if (f.host == "" || isAnyHost(f.host) || ipMatchesHost(dstIP, f.host)) && tcp.DstPort == layers.TCPPort(f.port) {
+		return dumper.SrcToDst
+	}
+	if (f.host == "" || isAnyHost(f.host) || ipMatchesHost(srcIP, f.host)) && tcp.SrcPort == layers.TCPPort(f.port) {
+		return dumper.DstToSrc
+	}
+	return dumper.Unknown
+}
+
+// flowIPs extracts the src/dst net.IP of a gopacket network flow, whether
+// it carries IPv4 or IPv6 endpoints.
+func flowIPs(netFlow gopacket.Flow) (net.IP, net.IP) {
+	src, dst := netFlow.Endpoints()
+	return net.IP(src.Raw()), net.IP(dst.Raw())
+}
+
+// isAnyHost reports whether host is the IPv4 or IPv6 "any address",
+// matching every connection the way an empty host does.
+func isAnyHost(host string) bool {
+	return host == anyIP || host == anyIPv6
+}
+
+// ipMatchesHost compares a packet's address against the configured host,
+// parsing host as an IP so "::1" and "0:0:0:0:0:0:0:1" compare equal.
+func ipMatchesHost(ip net.IP, host string) bool {
+	hostIP := net.ParseIP(host)
+	if hostIP == nil {
+		return ip.String() == host
+	}
+	return ip.Equal(hostIP)
+}
+
+// mssOption extracts the TCP MSS option value, if present, instead of the
+// old fixed-offset read into LayerContents().
+func mssOption(tcp *layers.TCP) (int, bool) {
+	for _, opt := range tcp.Options {
+		if opt.OptionType == layers.TCPOptionKindMSS && len(opt.OptionData) == 2 {
+			return int(opt.OptionData[0])<<8 | int(opt.OptionData[1]), true
+		}
+	}
+	return 0, false
+}
+
+// addLocalProcDumpValues resolves the local process (pid/comm/user) owning
+// either side of the flow and, on a hit, adds it to connMetadata so every
+// subsequent dump from this connection carries it. The destination side of
+// the packet that opened the flow (the server, when that packet is the
+// client's SYN) is tried first; the configured probe target is not consulted.
+func addLocalProcDumpValues(netFlow gopacket.Flow, tcp *layers.TCP, connMetadata *dumper.ConnMetadata) {
+	srcIP, dstIP := flowIPs(netFlow)
+
+	info, ok := procs.Lookup(dstIP, uint16(tcp.DstPort))
+	if !ok {
+		info, ok = procs.Lookup(srcIP, uint16(tcp.SrcPort))
+	}
+	if !ok {
+		return
+	}
+
+	connMetadata.DumpValues = append(connMetadata.DumpValues,
+		dumper.DumpValue{Key: "local_pid", Value: info.Pid},
+		dumper.DumpValue{Key: "local_comm", Value: info.Comm},
+		dumper.DumpValue{Key: "local_user", Value: info.User},
+	)
+}
+
+// tcpStream implements reassembly.Stream, handing contiguous reassembled
+// byte runs for a single TCP flow to the configured dumper.
+type tcpStream struct {
+	reader       *PacketReader
+	net          gopacket.Flow
+	transport    gopacket.Flow
+	direction    dumper.Direction
+	connMetadata *dumper.ConnMetadata
+}
+
+// Accept implements reassembly.Stream. All segments of a tracked flow are
+// accepted; filtering already happened via the BPF filter and the capture
+// loop.
+func (s *tcpStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence, start *bool, ac reassembly.AssemblerContext) bool {
+	return true
+}
+
+// ReassembledSG implements reassembly.Stream. It receives a contiguous byte
+// run for one direction of the flow and passes it to the dumper.
+func (s *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	length, _ := sg.Lengths()
+	dir, _, _, skip := sg.Info()
+
+	if skip > 0 {
+		metrics.ReassemblyGapsTotal.Add(float64(skip))
+		s.reader.logger.Info("reassembly gap",
+			zap.Int("skip", skip),
+			zap.String("net", s.net.String()),
+			zap.String("transport", s.transport.String()),
+		)
+	}
+	if length == 0 {
+		return
+	}
+
+	in := sg.Fetch(length)
+	direction := s.directionFor(dir)
+	metrics.DumperBytesProcessedTotal.WithLabelValues(dumperName(s.reader.dumper)).Add(float64(length))
+
+	read, err := s.reader.dumper.Read(in, direction, s.connMetadata)
+	if err != nil {
+		metrics.DumperErrorsTotal.WithLabelValues(dumperName(s.reader.dumper)).Inc()
+		s.reader.logger.Info("dumper parse error",
+			zap.Error(err),
+			zap.String("conn_id", dumper.ConnID(s.connMetadata)),
+			zap.String("net", s.net.String()),
+			zap.String("transport", s.transport.String()),
+		)
+	}
+	if len(read) == 0 {
+		metrics.PacketsDroppedTotal.WithLabelValues("no_dump_data").Inc()
+		return
+	}
+
+	srcAddr, dstAddr := s.addrsFor(dir)
+	values := []dumper.DumpValue{
+		dumper.DumpValue{
+			Key:   "ts",
+			Value: ac.GetCaptureInfo().Timestamp,
+		},
+		dumper.DumpValue{
+			Key:   "src_addr",
+			Value: srcAddr,
+		},
+		dumper.DumpValue{
+			Key:   "dst_addr",
+			Value: dstAddr,
+		},
+	}
+	values = append(values, read...)
+	values = append(values, s.reader.pValues...)
+	values = append(values, s.connMetadata.DumpValues...)
+
+	s.reader.dumper.Log(values)
+}
+
+// connCloser is implemented by dumpers that keep per-connection scratch
+// state (keyed by conn_id) and need to release it once a flow is torn
+// down, rather than leaking an entry for every connection ever seen.
+type connCloser interface {
+	CloseConn(connMetadata *dumper.ConnMetadata)
+}
+
+// ReassemblyComplete implements reassembly.Stream. FIN/RST teardown is
+// driven entirely by the assembler calling this once a flow is done.
+func (s *tcpStream) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	if closer, ok := s.reader.dumper.(connCloser); ok {
+		closer.CloseConn(s.connMetadata)
+	}
+	metrics.ActiveConnections.Dec()
+	metrics.TCPFlagsObservedTotal.WithLabelValues("fin", directionLabel(s.direction)).Inc()
+	return true
+}
+
+// dumperName labels metrics by the concrete Dumper implementation in use.
+func dumperName(d dumper.Dumper) string {
+	return fmt.Sprintf("%T", d)
+}
+
+func (s *tcpStream) directionFor(dir reassembly.TCPFlowDirection) dumper.Direction {
+	if s.direction == dumper.Unknown {
+		return dumper.Unknown
+	}
+	if dir == reassembly.TCPDirClientToServer {
+		return s.direction
+	}
+	if s.direction == dumper.SrcToDst {
+		return dumper.DstToSrc
+	}
+	return dumper.SrcToDst
+}
+
+func (s *tcpStream) addrsFor(dir reassembly.TCPFlowDirection) (string, string) {
+	srcIP, dstIP := flowIPs(s.net)
+	srcPortEP, dstPortEP := s.transport.Endpoints()
+	if dir == reassembly.TCPDirClientToServer {
+		return formatAddr(srcIP, srcPortEP.String()), formatAddr(dstIP, dstPortEP.String())
+	}
+	return formatAddr(dstIP, dstPortEP.String()), formatAddr(srcIP, srcPortEP.String())
+}
+
+// formatAddr renders an address as "ip:port", bracketing the IP when it's
+// IPv6 so the dump value stays unambiguous for downstream log consumers.
+func formatAddr(ip net.IP, port string) string {
+	if ip.To4() == nil {
+		return fmt.Sprintf("[%s]:%s", ip.String(), port)
+	}
+	return fmt.Sprintf("%s:%s", ip.String(), port)
+}
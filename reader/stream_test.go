@@ -0,0 +1,126 @@
+package reader
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/k1LoW/tcpdp/dumper"
+)
+
+// flowFor builds a gopacket network flow for src/dst, picking the IPv4 or
+// IPv6 endpoint type to match whichever address family was given.
+func flowFor(t *testing.T, src, dst net.IP) gopacket.Flow {
+	t.Helper()
+	if src.To4() == nil || dst.To4() == nil {
+		return gopacket.NewFlow(layers.EndpointIPv6, src.To16(), dst.To16())
+	}
+	return gopacket.NewFlow(layers.EndpointIPv4, src.To4(), dst.To4())
+}
+
+func TestTcpStreamFactoryDirection(t *testing.T) {
+	cases := []struct {
+		name             string
+		host             string
+		src, dst         net.IP
+		srcPort, dstPort layers.TCPPort
+		want             dumper.Direction
+	}{
+		{"client to server", "10.0.0.2", net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), 54321, 3306, dumper.SrcToDst},
+		{"server to client", "10.0.0.2", net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), 3306, 54321, dumper.DstToSrc},
+		{"neither side matches the target", "10.0.0.2", net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.4"), 1111, 2222, dumper.Unknown},
+		{"IPv6 client to server", "::2", net.ParseIP("::1"), net.ParseIP("::2"), 54321, 3306, dumper.SrcToDst},
+		{"IPv6 server to client", "::2", net.ParseIP("::2"), net.ParseIP("::1"), 3306, 54321, dumper.DstToSrc},
+		{"IPv6 neither side matches the target", "::2", net.ParseIP("::3"), net.ParseIP("::4"), 1111, 2222, dumper.Unknown},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			factory := &tcpStreamFactory{host: c.host, port: 3306}
+			netFlow := flowFor(t, c.src, c.dst)
+			tcp := &layers.TCP{SrcPort: c.srcPort, DstPort: c.dstPort}
+
+			if got := factory.direction(netFlow, tcp); got != c.want {
+				t.Errorf("direction() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatAddr(t *testing.T) {
+	cases := []struct {
+		name string
+		ip   net.IP
+		port string
+		want string
+	}{
+		{"IPv4", net.ParseIP("10.0.0.1"), "3306", "10.0.0.1:3306"},
+		{"IPv6", net.ParseIP("::1"), "3306", "[::1]:3306"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := formatAddr(c.ip, c.port); got != c.want {
+				t.Errorf("formatAddr() = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestIpMatchesHost(t *testing.T) {
+	cases := []struct {
+		name string
+		ip   net.IP
+		host string
+		want bool
+	}{
+		{"IPv4 match", net.ParseIP("10.0.0.1"), "10.0.0.1", true},
+		{"IPv4 mismatch", net.ParseIP("10.0.0.1"), "10.0.0.2", false},
+		{"IPv6 match", net.ParseIP("::1"), "::1", true},
+		{"IPv6 expanded form matches the compressed form", net.ParseIP("::1"), "0:0:0:0:0:0:0:1", true},
+		{"IPv6 mismatch", net.ParseIP("::1"), "::2", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ipMatchesHost(c.ip, c.host); got != c.want {
+				t.Errorf("ipMatchesHost() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// fakeDumper is a minimal dumper.Dumper that also implements connCloser,
+// so tests can assert ReassemblyComplete releases per-connection state.
+type fakeDumper struct {
+	closed []string
+}
+
+func (d *fakeDumper) NewConnMetadata() *dumper.ConnMetadata {
+	return &dumper.ConnMetadata{}
+}
+
+func (d *fakeDumper) Read(in []byte, direction dumper.Direction, connMetadata *dumper.ConnMetadata) ([]dumper.DumpValue, error) {
+	return nil, nil
+}
+
+func (d *fakeDumper) Log(values []dumper.DumpValue) {}
+
+func (d *fakeDumper) CloseConn(connMetadata *dumper.ConnMetadata) {
+	d.closed = append(d.closed, dumper.ConnID(connMetadata))
+}
+
+func TestTcpStreamReassemblyCompleteClosesConn(t *testing.T) {
+	fd := &fakeDumper{}
+	reader := &PacketReader{dumper: fd}
+	connMetadata := &dumper.ConnMetadata{
+		DumpValues: []dumper.DumpValue{{Key: "conn_id", Value: "abc123"}},
+	}
+	stream := &tcpStream{reader: reader, connMetadata: connMetadata}
+
+	if cont := stream.ReassemblyComplete(nil); !cont {
+		t.Fatalf("ReassemblyComplete() = false, want true")
+	}
+	if len(fd.closed) != 1 || fd.closed[0] != "abc123" {
+		t.Errorf("CloseConn not called with conn_id, got %v", fd.closed)
+	}
+}